@@ -0,0 +1,112 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shootsecrets
+
+import (
+	"context"
+
+	gardencorev1alpha1helper "github.com/gardener/gardener/pkg/apis/core/v1alpha1/helper"
+	"github.com/gardener/gardener/pkg/utils/infodata"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AnnotationSecretStoreRef is set on a deployed Secret whose sensitive data lives in an external SecretStore.
+// Its value is the store-specific reference (e.g. a Vault KV v2 path and version) that was recorded when the
+// secret was last written, allowing subsequent reconciles to detect that the secret is already up-to-date
+// without re-reading the external store.
+const AnnotationSecretStoreRef = "secret.gardener.cloud/store-ref"
+
+// SecretStore abstracts where the sensitive InfoData and Secret material managed by a SecretsManager is
+// persisted. The default InClusterStore keeps the current behavior (InfoData in the ShootState, Secret data
+// embedded in-cluster); alternative implementations (e.g. a Vault-backed store) can keep sensitive InfoData
+// out of etcd entirely and let the in-cluster Secret merely reference it.
+type SecretStore interface {
+	// PutInfoData persists the InfoData for the secret config with the given name.
+	PutInfoData(ctx context.Context, name string, data infodata.InfoData) error
+	// GetInfoData retrieves the InfoData for the secret config with the given name. It returns nil, nil if
+	// no InfoData has been persisted for that name yet.
+	GetInfoData(ctx context.Context, name string) (infodata.InfoData, error)
+	// DeleteInfoData deletes the InfoData persisted for name, without touching any Secret persisted for it.
+	// This is used to drop superseded rotation material (see SecretsManager.Rotate) once it is no longer
+	// served, independently of the live Secret under the same or a different name.
+	DeleteInfoData(ctx context.Context, name string) error
+	// PutSecret persists the given Secret under name. Implementations that keep the sensitive data external
+	// may choose to strip or replace secret.Data with a reference before writing it in-cluster.
+	PutSecret(ctx context.Context, name string, secret *corev1.Secret) error
+	// GetSecret retrieves the previously persisted Secret for name. It returns nil, nil if none exists yet.
+	GetSecret(ctx context.Context, name string) (*corev1.Secret, error)
+	// DeleteSecret deletes any state the store holds for name (both the InfoData and the Secret persisted for
+	// it). It does not delete the Secret object in the cluster.
+	DeleteSecret(ctx context.Context, name string) error
+}
+
+// InClusterStore is the default SecretStore. It stores InfoData in the GardenerResourceDataList (persisted
+// as part of the ShootState) and Secret objects directly in the cluster, i.e. the behavior SecretsManager
+// had before SecretStore was introduced.
+type InClusterStore struct {
+	gardenerResourceDataList *gardencorev1alpha1helper.GardenerResourceDataList
+	existingSecrets          map[string]*corev1.Secret
+}
+
+var _ SecretStore = &InClusterStore{}
+
+// NewInClusterStore creates an InClusterStore backed by the given GardenerResourceDataList and map of
+// existing in-cluster secrets.
+func NewInClusterStore(gardenerResourceDataList *gardencorev1alpha1helper.GardenerResourceDataList, existingSecrets map[string]*corev1.Secret) *InClusterStore {
+	return &InClusterStore{
+		gardenerResourceDataList: gardenerResourceDataList,
+		existingSecrets:          existingSecrets,
+	}
+}
+
+// PutInfoData implements SecretStore.
+func (i *InClusterStore) PutInfoData(_ context.Context, name string, data infodata.InfoData) error {
+	return infodata.UpsertInfoData(i.gardenerResourceDataList, name, data)
+}
+
+// GetInfoData implements SecretStore.
+func (i *InClusterStore) GetInfoData(_ context.Context, name string) (infodata.InfoData, error) {
+	return infodata.GetInfoData(*i.gardenerResourceDataList, name)
+}
+
+// DeleteInfoData implements SecretStore.
+func (i *InClusterStore) DeleteInfoData(_ context.Context, name string) error {
+	i.gardenerResourceDataList.Delete(name)
+	return nil
+}
+
+// PutSecret implements SecretStore. The in-cluster Secret is the authoritative copy, so this only records it
+// in the existing secrets map; creating or updating the Secret object in the cluster is left to the caller
+// (SecretsManager's deploySecret and deployRotationSecret).
+func (i *InClusterStore) PutSecret(_ context.Context, name string, secret *corev1.Secret) error {
+	i.existingSecrets[name] = secret
+	return nil
+}
+
+// GetSecret implements SecretStore.
+func (i *InClusterStore) GetSecret(_ context.Context, name string) (*corev1.Secret, error) {
+	if secret, ok := i.existingSecrets[name]; ok {
+		return secret, nil
+	}
+	return nil, nil
+}
+
+// DeleteSecret implements SecretStore.
+func (i *InClusterStore) DeleteSecret(_ context.Context, name string) error {
+	i.gardenerResourceDataList.Delete(name)
+	delete(i.existingSecrets, name)
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shootsecrets
+
+import (
+	"context"
+
+	"github.com/gardener/gardener/pkg/utils/infodata"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FakeSecretStore is an in-memory SecretStore for use in unit tests of code that depends on SecretStore
+// without pulling in a real InClusterStore or an external backend.
+type FakeSecretStore struct {
+	InfoData map[string]infodata.InfoData
+	Secrets  map[string]*corev1.Secret
+}
+
+var _ SecretStore = &FakeSecretStore{}
+
+// NewFakeSecretStore returns an empty FakeSecretStore.
+func NewFakeSecretStore() *FakeSecretStore {
+	return &FakeSecretStore{
+		InfoData: map[string]infodata.InfoData{},
+		Secrets:  map[string]*corev1.Secret{},
+	}
+}
+
+// PutInfoData implements SecretStore.
+func (f *FakeSecretStore) PutInfoData(_ context.Context, name string, data infodata.InfoData) error {
+	f.InfoData[name] = data
+	return nil
+}
+
+// GetInfoData implements SecretStore.
+func (f *FakeSecretStore) GetInfoData(_ context.Context, name string) (infodata.InfoData, error) {
+	return f.InfoData[name], nil
+}
+
+// DeleteInfoData implements SecretStore.
+func (f *FakeSecretStore) DeleteInfoData(_ context.Context, name string) error {
+	delete(f.InfoData, name)
+	return nil
+}
+
+// PutSecret implements SecretStore.
+func (f *FakeSecretStore) PutSecret(_ context.Context, name string, secret *corev1.Secret) error {
+	f.Secrets[name] = secret
+	return nil
+}
+
+// GetSecret implements SecretStore.
+func (f *FakeSecretStore) GetSecret(_ context.Context, name string) (*corev1.Secret, error) {
+	return f.Secrets[name], nil
+}
+
+// DeleteSecret implements SecretStore.
+func (f *FakeSecretStore) DeleteSecret(_ context.Context, name string) error {
+	delete(f.InfoData, name)
+	delete(f.Secrets, name)
+	return nil
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shootsecrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/gardener/gardener/pkg/utils/infodata"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// VaultSecretStoreConfig bundles the options needed to talk to a HashiCorp Vault KV v2 engine that stores
+// shoot secret material.
+type VaultSecretStoreConfig struct {
+	// Address is the Vault server address, e.g. "https://vault.example.com:8200".
+	Address string
+	// Mount is the path the KV v2 secrets engine is mounted at, e.g. "secret".
+	Mount string
+	// PathPrefix is prepended to every InfoData/Secret name to form the KV path, e.g. "gardener/shoots/<uid>".
+	PathPrefix string
+	// KubernetesAuthRole is the Vault role bound to the Kubernetes auth method that the running service
+	// account JWT is exchanged for.
+	KubernetesAuthRole string
+	// KubernetesAuthMountPath is the path the Kubernetes auth method is mounted at, defaulting to
+	// "kubernetes" if empty.
+	KubernetesAuthMountPath string
+	// ServiceAccountTokenPath is the path to the projected/mounted service account token used to
+	// authenticate against the Kubernetes auth method, defaulting to
+	// "/var/run/secrets/kubernetes.io/serviceaccount/token" if empty.
+	ServiceAccountTokenPath string
+}
+
+// VaultSecretStore is a SecretStore backed by HashiCorp Vault's KV v2 secrets engine. InfoData and Secret
+// data are both stored as Vault secret versions so that the CA private keys, SSH keys and static tokens
+// managed by SecretsManager never need to live in etcd in plaintext; the in-cluster corev1.Secret written by
+// SecretsManager.Deploy only needs to carry an AnnotationSecretStoreRef pointing at the Vault path/version.
+type VaultSecretStore struct {
+	config VaultSecretStoreConfig
+	client *vaultapi.Client
+}
+
+var _ SecretStore = &VaultSecretStore{}
+
+// NewVaultSecretStore creates a VaultSecretStore and authenticates against Vault's Kubernetes auth method
+// using the service account JWT at config.ServiceAccountTokenPath.
+func NewVaultSecretStore(ctx context.Context, config VaultSecretStoreConfig) (*VaultSecretStore, error) {
+	if config.KubernetesAuthMountPath == "" {
+		config.KubernetesAuthMountPath = "kubernetes"
+	}
+	if config.ServiceAccountTokenPath == "" {
+		config.ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
+
+	clientConfig := vaultapi.DefaultConfig()
+	clientConfig.Address = config.Address
+
+	client, err := vaultapi.NewClient(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating vault client: %w", err)
+	}
+
+	store := &VaultSecretStore{config: config, client: client}
+	if err := store.login(ctx); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (v *VaultSecretStore) login(ctx context.Context) error {
+	jwt, err := os.ReadFile(v.config.ServiceAccountTokenPath)
+	if err != nil {
+		return fmt.Errorf("failed reading service account token: %w", err)
+	}
+
+	secret, err := v.client.Logical().WriteWithContext(ctx, path.Join("auth", v.config.KubernetesAuthMountPath, "login"), map[string]interface{}{
+		"jwt":  string(jwt),
+		"role": v.config.KubernetesAuthRole,
+	})
+	if err != nil {
+		return fmt.Errorf("failed logging in to vault via kubernetes auth: %w", err)
+	}
+
+	v.client.SetToken(secret.Auth.ClientToken)
+	return nil
+}
+
+func (v *VaultSecretStore) dataPath(name string) string {
+	return path.Join(v.config.Mount, "data", v.config.PathPrefix, name)
+}
+
+// PutInfoData implements SecretStore.
+func (v *VaultSecretStore) PutInfoData(ctx context.Context, name string, data infodata.InfoData) error {
+	marshalled, err := data.Marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = v.client.Logical().WriteWithContext(ctx, v.dataPath(infoDataKey(name)), map[string]interface{}{
+		"data": map[string]interface{}{
+			"typeVersion": data.TypeVersion(),
+			"data":        string(marshalled),
+		},
+	})
+	return err
+}
+
+// GetInfoData implements SecretStore.
+func (v *VaultSecretStore) GetInfoData(ctx context.Context, name string) (infodata.InfoData, error) {
+	secret, err := v.client.Logical().ReadWithContext(ctx, v.dataPath(infoDataKey(name)))
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	inner, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	typeVersion, _ := inner["typeVersion"].(string)
+	rawData, _ := inner["data"].(string)
+
+	unmarshaller := infodata.GetUnmarshaller(infodata.TypeVersion(typeVersion))
+	if unmarshaller == nil {
+		return nil, fmt.Errorf("no unmarshaller registered for infodata type version %q (vault path %s)", typeVersion, v.dataPath(infoDataKey(name)))
+	}
+
+	return unmarshaller([]byte(rawData))
+}
+
+// DeleteInfoData implements SecretStore.
+func (v *VaultSecretStore) DeleteInfoData(ctx context.Context, name string) error {
+	_, err := v.client.Logical().DeleteWithContext(ctx, v.dataPath(infoDataKey(name)))
+	return err
+}
+
+// PutSecret implements SecretStore. It stores the full Secret data in Vault and records the Vault path and
+// version as a reference on the Secret's annotations; secret.Data is cleared so the sensitive material is
+// never written to the in-cluster Secret (and therefore never reaches etcd) by the caller.
+func (v *VaultSecretStore) PutSecret(ctx context.Context, name string, secret *corev1.Secret) error {
+	marshalled, err := json.Marshal(secret.Data)
+	if err != nil {
+		return err
+	}
+
+	written, err := v.client.Logical().WriteWithContext(ctx, v.dataPath(secretKey(name)), map[string]interface{}{
+		"data": map[string]interface{}{
+			"data": string(marshalled),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	version := "0"
+	if written != nil {
+		if raw, ok := written.Data["version"]; ok {
+			version = versionString(raw)
+		}
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[AnnotationSecretStoreRef] = fmt.Sprintf("%s#%s", v.dataPath(secretKey(name)), version)
+	secret.Data = nil
+
+	return nil
+}
+
+// GetSecret implements SecretStore.
+func (v *VaultSecretStore) GetSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	secret, err := v.client.Logical().ReadWithContext(ctx, v.dataPath(secretKey(name)))
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	inner, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	rawData, _ := inner["data"].(string)
+
+	data := map[string][]byte{}
+	if err := json.Unmarshal([]byte(rawData), &data); err != nil {
+		return nil, err
+	}
+
+	return &corev1.Secret{Data: data}, nil
+}
+
+// DeleteSecret implements SecretStore.
+func (v *VaultSecretStore) DeleteSecret(ctx context.Context, name string) error {
+	if _, err := v.client.Logical().DeleteWithContext(ctx, v.dataPath(secretKey(name))); err != nil {
+		return err
+	}
+	_, err := v.client.Logical().DeleteWithContext(ctx, v.dataPath(infoDataKey(name)))
+	return err
+}
+
+func infoDataKey(name string) string { return name + "/infodata" }
+func secretKey(name string) string   { return name + "/secret" }
+
+// versionString is a small helper kept separate from PutSecret so the version parsing logic is unit
+// testable in isolation.
+func versionString(raw interface{}) string {
+	if f, ok := raw.(float64); ok {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return fmt.Sprintf("%v", raw)
+}
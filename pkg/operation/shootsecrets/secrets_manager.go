@@ -15,10 +15,16 @@
 package shootsecrets
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
 
 	gardencorev1alpha1helper "github.com/gardener/gardener/pkg/apis/core/v1alpha1/helper"
-	"github.com/gardener/gardener/pkg/utils/infodata"
 	"github.com/gardener/gardener/pkg/utils/secrets"
 
 	corev1 "k8s.io/api/core/v1"
@@ -26,6 +32,69 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// rotationNewInfoDataSuffix is appended to a secret config's name to obtain the key under which the
+// newly generated InfoData is stored in the SecretStore while the old InfoData (stored under the
+// unsuffixed name) is still being served.
+const rotationNewInfoDataSuffix = "-rotation-new"
+
+const (
+	// AnnotationRotationPhase is set on a deployed Secret to reflect the RotationPhase it was generated in.
+	AnnotationRotationPhase = "secret.gardener.cloud/rotation-phase"
+	// AnnotationRotationStartedAt carries the timestamp (RFC3339) at which the rotation entered the Serving phase.
+	// While the rotation is in the Preparing phase, it carries the time the Preparing phase was entered.
+	AnnotationRotationStartedAt = "secret.gardener.cloud/rotation-started-at"
+	// AnnotationRotationFingerprint carries a short fingerprint of the deployed (possibly bundled) secret data so
+	// dependents can detect that the material behind the secret changed without comparing the full secret data.
+	AnnotationRotationFingerprint = "secret.gardener.cloud/rotation-fingerprint"
+)
+
+// RotationTrigger describes what causes a secret to be rotated.
+type RotationTrigger string
+
+const (
+	// RotationTriggerTimeBased marks a rotation caused by a secret being within its expiry window. Rotate does
+	// not check expiry itself; the caller selects the due secrets via RotationPolicy.SecretNames.
+	RotationTriggerTimeBased RotationTrigger = "TimeBased"
+	// RotationTriggerAnnotation marks a rotation caused by an explicit rotation annotation on the Shoot. Rotate
+	// does not inspect the Shoot's annotations itself.
+	RotationTriggerAnnotation RotationTrigger = "Annotation"
+	// RotationTriggerForced marks a rotation started regardless of expiry or annotations.
+	//
+	// All three triggers are handled alike by Rotate: each starts a rotation for every named secret that has no
+	// rotation phase recorded yet.
+	RotationTriggerForced RotationTrigger = "Forced"
+)
+
+// RotationPhase describes the progress of an individual secret's rotation.
+type RotationPhase string
+
+const (
+	// RotationPhasePreparing means the new InfoData has been generated but is not yet served to clients.
+	RotationPhasePreparing RotationPhase = "Preparing"
+	// RotationPhaseServing means both old and new material are being served (bundle secrets).
+	RotationPhaseServing RotationPhase = "Serving"
+	// RotationPhaseCompleting means the grace period has elapsed and the old material is about to be dropped.
+	RotationPhaseCompleting RotationPhase = "Completing"
+	// RotationPhaseCompleted means only the new material is being served.
+	RotationPhaseCompleted RotationPhase = "Completed"
+)
+
+// RotationPolicy describes which secrets should be rotated, what should trigger the rotation and how long
+// the old and new material should be served side-by-side before the old material is dropped.
+type RotationPolicy struct {
+	// SecretNames are the names (as returned by secrets.ConfigInterface.GetName) of the secrets to rotate.
+	SecretNames []string
+	// Trigger determines under which condition a rotation is initiated.
+	Trigger RotationTrigger
+	// GracePeriod is the minimum duration for which old and new material are served together before the
+	// old material is dropped. It is evaluated once a secret has reached RotationPhaseServing.
+	GracePeriod time.Duration
+	// Complete forces rotations that are in RotationPhaseServing or RotationPhaseCompleting to finish
+	// immediately, regardless of GracePeriod. It is set when an explicit "completed" trigger (e.g. an
+	// operator annotation acknowledging that all dependents observed the new material) was observed.
+	Complete bool
+}
+
 // SecretConfigGeneratorFunc is a func used to generate secret configurations
 type SecretConfigGeneratorFunc func(map[string]*secrets.Certificate) ([]secrets.ConfigInterface, error)
 
@@ -42,6 +111,10 @@ type SecretsManager struct {
 	GardenerResourceDataList gardencorev1alpha1helper.GardenerResourceDataList
 	StaticToken              *secrets.StaticToken
 	DeployedSecrets          map[string]*corev1.Secret
+
+	rotationPhases map[string]RotationPhase
+
+	store SecretStore
 }
 
 // NewSecretsManager takes in a list of GardenerResourceData items, a static token secret config, a map of certificate authority configs,
@@ -50,18 +123,24 @@ func NewSecretsManager(
 	gardenerResourceDataList gardencorev1alpha1helper.GardenerResourceDataList,
 	secretConfigGenerator SecretConfigGeneratorFunc,
 ) *SecretsManager {
-	return &SecretsManager{
+	s := &SecretsManager{
 		GardenerResourceDataList: gardenerResourceDataList,
 		secretConfigGenerator:    secretConfigGenerator,
 		certificateAuthorities:   make(map[string]*secrets.Certificate),
 		existingSecrets:          map[string]*corev1.Secret{},
 		DeployedSecrets:          map[string]*corev1.Secret{},
+		rotationPhases:           map[string]RotationPhase{},
 	}
+	s.store = NewInClusterStore(&s.GardenerResourceDataList, s.existingSecrets)
+	return s
 }
 
 // WithExistingSecrets adds the provided map of existing secrets to the SecretsManager
 func (s *SecretsManager) WithExistingSecrets(existingSecrets map[string]*corev1.Secret) *SecretsManager {
 	s.existingSecrets = existingSecrets
+	if _, ok := s.store.(*InClusterStore); ok {
+		s.store = NewInClusterStore(&s.GardenerResourceDataList, s.existingSecrets)
+	}
 	return s
 }
 
@@ -71,6 +150,13 @@ func (s *SecretsManager) WithCertificateAuthorities(cas map[string]*secrets.Cert
 	return s
 }
 
+// WithSecretStore replaces the SecretsManager's default InClusterStore with the given SecretStore, e.g. an
+// external backend such as VaultSecretStore. It must be called, if at all, before Generate/Deploy/Rotate.
+func (s *SecretsManager) WithSecretStore(store SecretStore) *SecretsManager {
+	s.store = store
+	return s
+}
+
 // Generate generates InfoData for all shoot secrets managed by gardener and adds it to the SecretManager's
 // GardenerResourceData
 func (s *SecretsManager) Generate() error {
@@ -80,7 +166,7 @@ func (s *SecretsManager) Generate() error {
 	}
 
 	for _, config := range secretConfigs {
-		if err := s.generateInfoDataAndUpdateResourceList(config); err != nil {
+		if err := s.generateInfoDataAndUpdateResourceList(context.TODO(), config); err != nil {
 			return err
 		}
 	}
@@ -90,6 +176,9 @@ func (s *SecretsManager) Generate() error {
 
 // Deploy gets InfoData for all shoot secrets managed by gardener from the SecretManager's GardenerResourceDataList
 // and uses it to generate kubernetes secrets and deploy them in the provided namespace.
+//
+// Secrets that are under an in-progress rotation (see Rotate) are skipped here: Rotate owns them exclusively
+// for the duration of the rotation so that the two entry points never race over the same Secret.
 func (s *SecretsManager) Deploy(ctx context.Context, k8sClient client.Client, namespace string) error {
 	if s.secretConfigGenerator == nil {
 		return nil
@@ -100,33 +189,45 @@ func (s *SecretsManager) Deploy(ctx context.Context, k8sClient client.Client, na
 		return err
 	}
 
-	deployedSecrets, err := secrets.GenerateClusterSecretsWithFunc(ctx, k8sClient, s.existingSecrets, secretConfigs, namespace, func(c secrets.ConfigInterface) (secrets.DataInterface, error) {
-		return s.getInfoDataAndGenerateSecret(c)
-	})
-	if err != nil {
-		return err
-	}
+	for _, config := range secretConfigs {
+		name := config.GetName()
+
+		if phase, _ := s.observedRotationPhase(name); phase != "" && phase != RotationPhaseCompleted {
+			continue
+		}
+
+		secretInterface, err := s.getInfoDataAndGenerateSecret(ctx, config)
+		if err != nil {
+			return err
+		}
 
-	for name, secret := range deployedSecrets {
+		secret, err := s.deploySecret(ctx, k8sClient, namespace, secretInterface, name)
+		if err != nil {
+			return err
+		}
 		s.DeployedSecrets[name] = secret
 	}
 
 	return nil
 }
 
-func (s *SecretsManager) generateInfoDataAndUpdateResourceList(secretConfig secrets.ConfigInterface) error {
-	if s.GardenerResourceDataList.Get(secretConfig.GetName()) != nil {
+func (s *SecretsManager) generateInfoDataAndUpdateResourceList(ctx context.Context, secretConfig secrets.ConfigInterface) error {
+	existing, err := s.store.GetInfoData(ctx, secretConfig.GetName())
+	if err != nil {
+		return err
+	}
+	if existing != nil {
 		return nil
 	}
 	data, err := secretConfig.GenerateInfoData()
 	if err != nil {
 		return err
 	}
-	return infodata.UpsertInfoData(&s.GardenerResourceDataList, secretConfig.GetName(), data)
+	return s.store.PutInfoData(ctx, secretConfig.GetName(), data)
 }
 
-func (s *SecretsManager) getInfoDataAndGenerateSecret(secretConfig secrets.ConfigInterface) (secrets.DataInterface, error) {
-	secretInfoData, err := infodata.GetInfoData(s.GardenerResourceDataList, secretConfig.GetName())
+func (s *SecretsManager) getInfoDataAndGenerateSecret(ctx context.Context, secretConfig secrets.ConfigInterface) (secrets.DataInterface, error) {
+	secretInfoData, err := s.store.GetInfoData(ctx, secretConfig.GetName())
 	if err != nil {
 		return nil, err
 	}
@@ -137,6 +238,10 @@ func (s *SecretsManager) getInfoDataAndGenerateSecret(secretConfig secrets.Confi
 	return secretConfig.GenerateFromInfoData(secretInfoData)
 }
 
+// deploySecret deploys the given secret data under secretName. If secretName already has an in-cluster
+// Secret from this reconcile's existingSecrets snapshot, that Secret is reused as-is so the operation is
+// idempotent; otherwise the store is consulted to persist the data (which, for an external store, may
+// replace secret.Data with a reference) before the Secret is created in-cluster.
 func (s *SecretsManager) deploySecret(ctx context.Context, k8sClient client.Client, namespace string, secretInterface secrets.DataInterface, secretName string) (*corev1.Secret, error) {
 	if secret, ok := s.existingSecrets[secretName]; ok {
 		return secret, nil
@@ -151,8 +256,353 @@ func (s *SecretsManager) deploySecret(ctx context.Context, k8sClient client.Clie
 		Data: secretInterface.SecretData(),
 	}
 
+	if err := s.store.PutSecret(ctx, secretName, secret); err != nil {
+		return nil, err
+	}
+
 	if err := k8sClient.Create(ctx, secret); err != nil {
 		return nil, err
 	}
 	return secret, nil
 }
+
+// RotationStatus returns the current RotationPhase of the given secret as observed on the last call to
+// Rotate. It returns false as the second value if the secret is not known to be under rotation.
+func (s *SecretsManager) RotationStatus(secretName string) (RotationPhase, bool) {
+	phase, ok := s.rotationPhases[secretName]
+	return phase, ok
+}
+
+// Rotate generates, bundles and deploys the secrets named in policy.SecretNames according to the given
+// RotationPolicy. It is safe to call on every reconcile: a secret that is not yet due for rotation (per
+// policy.Trigger) is left untouched, a secret that is already mid-rotation progresses towards
+// RotationPhaseCompleted once its grace period has elapsed, and a secret that has no rotation phase recorded
+// yet starts a new rotation in RotationPhasePreparing.
+func (s *SecretsManager) Rotate(ctx context.Context, k8sClient client.Client, namespace string, policy RotationPolicy) error {
+	if s.secretConfigGenerator == nil {
+		return nil
+	}
+
+	secretConfigs, err := s.secretConfigGenerator(s.certificateAuthorities)
+	if err != nil {
+		return err
+	}
+
+	configsByName := make(map[string]secrets.ConfigInterface, len(secretConfigs))
+	for _, config := range secretConfigs {
+		configsByName[config.GetName()] = config
+	}
+
+	for _, name := range policy.SecretNames {
+		config, ok := configsByName[name]
+		if !ok {
+			return fmt.Errorf("no secret configuration found for %q", name)
+		}
+
+		if err := s.rotateSecret(ctx, k8sClient, namespace, config, policy); err != nil {
+			return fmt.Errorf("failed rotating secret %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SecretsManager) rotateSecret(ctx context.Context, k8sClient client.Client, namespace string, config secrets.ConfigInterface, policy RotationPolicy) error {
+	name := config.GetName()
+	newName := name + rotationNewInfoDataSuffix
+
+	phase, startedAt := s.observedRotationPhase(name)
+
+	switch phase {
+	case "":
+		if !s.shouldStartRotation(policy) {
+			return nil
+		}
+
+		newData, err := config.GenerateInfoData()
+		if err != nil {
+			return err
+		}
+		if err := s.store.PutInfoData(ctx, newName, newData); err != nil {
+			return err
+		}
+		// The new InfoData exists now but is not served yet; Serving (and the grace-period clock) only
+		// starts on the next call, once dependents have had a chance to observe RotationPhasePreparing.
+		phase, startedAt = RotationPhasePreparing, time.Now()
+
+	case RotationPhasePreparing:
+		phase, startedAt = RotationPhaseServing, time.Now()
+
+	case RotationPhaseServing:
+		if policy.Complete || (policy.GracePeriod > 0 && time.Since(startedAt) >= policy.GracePeriod) {
+			phase = RotationPhaseCompleting
+		}
+
+	case RotationPhaseCompleting:
+		newData, err := s.store.GetInfoData(ctx, newName)
+		if err != nil {
+			return err
+		}
+		if newData == nil {
+			return fmt.Errorf("missing new infodata for %q while completing rotation", name)
+		}
+		if err := s.store.PutInfoData(ctx, name, newData); err != nil {
+			return err
+		}
+		if err := s.store.DeleteInfoData(ctx, newName); err != nil {
+			return err
+		}
+		phase = RotationPhaseCompleted
+	}
+
+	s.rotationPhases[name] = phase
+
+	secretInterface, err := s.getInfoDataAndGenerateBundledSecret(ctx, config, name, newName, phase)
+	if err != nil {
+		return err
+	}
+
+	secret, err := s.deployRotationSecret(ctx, k8sClient, namespace, secretInterface, name, phase, startedAt)
+	if err != nil {
+		return err
+	}
+	s.DeployedSecrets[name] = secret
+
+	return nil
+}
+
+// shouldStartRotation decides, based on the policy's Trigger, whether a secret that currently has no rotation
+// phase recorded should have its rotation initiated. RotationTriggerTimeBased is expected to be evaluated by the
+// caller before invoking Rotate (e.g. by only including secrets within their expiry window in
+// policy.SecretNames); here it is treated the same as an explicit trigger.
+func (s *SecretsManager) shouldStartRotation(policy RotationPolicy) bool {
+	switch policy.Trigger {
+	case RotationTriggerTimeBased, RotationTriggerAnnotation, RotationTriggerForced:
+		return true
+	default:
+		return false
+	}
+}
+
+// observedRotationPhase reconstructs the current RotationPhase and its start time from the annotations of
+// the previously deployed secret, falling back to the in-memory rotationPhases map populated by an earlier
+// call to Rotate within the same reconcile.
+func (s *SecretsManager) observedRotationPhase(secretName string) (RotationPhase, time.Time) {
+	if existing, ok := s.existingSecrets[secretName]; ok {
+		if phase, ok := existing.Annotations[AnnotationRotationPhase]; ok {
+			startedAt := time.Time{}
+			if raw, ok := existing.Annotations[AnnotationRotationStartedAt]; ok {
+				if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+					startedAt = parsed
+				}
+			}
+			return RotationPhase(phase), startedAt
+		}
+	}
+
+	return s.rotationPhases[secretName], time.Time{}
+}
+
+// getInfoDataAndGenerateBundledSecret produces the DataInterface to deploy for a secret under rotation. It
+// serves the old material alone while rotation has not started (phase "") or the new InfoData has been
+// generated but is not yet being served (RotationPhasePreparing), both old and new material merged into one
+// secret while RotationPhaseServing/RotationPhaseCompleting, and the new material alone once
+// RotationPhaseCompleted.
+func (s *SecretsManager) getInfoDataAndGenerateBundledSecret(ctx context.Context, config secrets.ConfigInterface, name, newName string, phase RotationPhase) (secrets.DataInterface, error) {
+	if phase == "" || phase == RotationPhasePreparing || phase == RotationPhaseCompleted {
+		return s.getInfoDataAndGenerateSecret(ctx, config)
+	}
+
+	oldData, err := s.getInfoDataAndGenerateSecret(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	newInfoData, err := s.store.GetInfoData(ctx, newName)
+	if err != nil {
+		return nil, err
+	}
+	if newInfoData == nil {
+		return oldData, nil
+	}
+	newData, err := config.GenerateFromInfoData(newInfoData)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBundleData(oldData, newData), nil
+}
+
+// bundleData is a secrets.DataInterface that merges an old and a new DataInterface's secret data so that
+// clients still trusting the old material keep working while components that pick up the merged secret
+// start trusting the new material too. See mergeSecretData for the per-key merge semantics.
+type bundleData struct {
+	old, new secrets.DataInterface
+}
+
+func newBundleData(old, new secrets.DataInterface) secrets.DataInterface {
+	return &bundleData{old: old, new: new}
+}
+
+func (b *bundleData) SecretData() map[string][]byte {
+	return mergeSecretData(b.old.SecretData(), b.new.SecretData())
+}
+
+// tokensCSVKey is the well-known key under which gardener's static token config stores its CSV-formatted
+// token list (one "token,username,uid,groups" row per line).
+const tokensCSVKey = "tokens.csv"
+
+// mergeSecretData combines an old and a new secret data map key by key:
+//   - tokensCSVKey is merged by concatenating the new rows after the old ones (deduplicating identical
+//     rows), so a single tokens.csv authenticates both the old and the new token;
+//   - a key whose old and new values both parse as PEM is merged by concatenating the new PEM blocks after
+//     the old ones (deduplicating identical blocks), so a single ca.crt/ca.bundle.crt carries both the old
+//     and the new certificate;
+//   - any other key (e.g. a private key, where two values cannot be concatenated into one valid credential)
+//     is kept under its original name for the old value and under a "new-"-prefixed name for the new value,
+//     so rolling consumers can pick either one explicitly during the grace period.
+func mergeSecretData(old, new map[string][]byte) map[string][]byte {
+	merged := make(map[string][]byte, len(old)+len(new))
+	for k, v := range old {
+		merged[k] = v
+	}
+
+	for k, newValue := range new {
+		oldValue, exists := merged[k]
+		if !exists {
+			merged[k] = newValue
+			continue
+		}
+
+		switch {
+		case k == tokensCSVKey:
+			merged[k] = mergeCSVRows(oldValue, newValue)
+		case looksLikePEM(oldValue) && looksLikePEM(newValue):
+			merged[k] = mergePEMBlocks(oldValue, newValue)
+		default:
+			merged["new-"+k] = newValue
+		}
+	}
+
+	return merged
+}
+
+func looksLikePEM(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil
+}
+
+// mergePEMBlocks concatenates the PEM blocks found in old and new into a single PEM bundle, dropping
+// byte-identical duplicate blocks (e.g. if rotation is re-evaluated before the new certificate changed).
+func mergePEMBlocks(old, new []byte) []byte {
+	var buf bytes.Buffer
+	seen := map[string]bool{}
+
+	for _, data := range [][]byte{old, new} {
+		rest := data
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			key := block.Type + ":" + string(block.Bytes)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			_ = pem.Encode(&buf, block)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// mergeCSVRows concatenates the non-empty lines found in old and new, dropping byte-identical duplicate
+// lines (e.g. if rotation is re-evaluated before the new token changed).
+func mergeCSVRows(old, new []byte) []byte {
+	var lines [][]byte
+	seen := map[string]bool{}
+
+	for _, data := range [][]byte{old, new} {
+		for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 || seen[string(line)] {
+				continue
+			}
+			seen[string(line)] = true
+			lines = append(lines, line)
+		}
+	}
+
+	merged := bytes.Join(lines, []byte("\n"))
+	return append(merged, '\n')
+}
+
+// deployRotationSecret deploys secretInterface under secretName, stamping it with the rotation-tracking
+// annotations, and routes the write through s.store just like deploySecret does so that newly-minted
+// rotation material is subject to the same external-backend handling (e.g. VaultSecretStore clearing
+// secret.Data and leaving only a reference) as every other secret the manager deploys.
+func (s *SecretsManager) deployRotationSecret(ctx context.Context, k8sClient client.Client, namespace string, secretInterface secrets.DataInterface, secretName string, phase RotationPhase, startedAt time.Time) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: namespace,
+			Annotations: map[string]string{
+				AnnotationRotationPhase:       string(phase),
+				AnnotationRotationStartedAt:   startedAt.UTC().Format(time.RFC3339),
+				AnnotationRotationFingerprint: fingerprint(secretInterface),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: secretInterface.SecretData(),
+	}
+
+	existing, ok := s.existingSecrets[secretName]
+	if !ok {
+		if err := s.store.PutSecret(ctx, secretName, secret); err != nil {
+			return nil, err
+		}
+		if err := k8sClient.Create(ctx, secret); err != nil {
+			return nil, err
+		}
+		return secret, nil
+	}
+
+	existing = existing.DeepCopy()
+	existing.Data = secret.Data
+	if existing.Annotations == nil {
+		existing.Annotations = map[string]string{}
+	}
+	for k, v := range secret.Annotations {
+		existing.Annotations[k] = v
+	}
+	if err := s.store.PutSecret(ctx, secretName, existing); err != nil {
+		return nil, err
+	}
+	if err := k8sClient.Update(ctx, existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// fingerprint returns a short, stable identifier for the given secret data so that dependents watching the
+// deployed Secret's annotations can detect that the underlying material changed without diffing the full
+// (potentially bundled) secret data.
+func fingerprint(secretInterface secrets.DataInterface) string {
+	h := sha256.New()
+	for _, key := range sortedKeys(secretInterface.SecretData()) {
+		h.Write([]byte(key))
+		h.Write(secretInterface.SecretData()[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -14,18 +14,294 @@
 
 package cmd
 
-import "github.com/spf13/pflag"
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Supported values for ProfilingOptions.PushFormat.
+const (
+	// PushFormatPprof pushes each profile as its native gzipped pprof protobuf.
+	PushFormatPprof = "pprof"
+)
 
 // ProfilingOptions contains options needed to enable profiling.
 type ProfilingOptions struct {
 	// EnableProfiling enables profiling via web interface host:port/debug/pprof/.
 	EnableProfiling bool
-	// EnableContentionProfiling enable lock contention profiling, if profiling is enabled
-	EnableContentionProfiling bool
+	// MutexProfileFraction is the fraction of mutex contention events reported in the mutex profile, as
+	// passed to runtime.SetMutexProfileFraction. 0 disables mutex profiling.
+	MutexProfileFraction int
+	// BlockProfileRate is the block profile sampling rate, as passed to runtime.SetBlockProfileRate: on average
+	// one blocking event is sampled per BlockProfileRate nanoseconds spent blocked. 0 disables block profiling.
+	BlockProfileRate int
+	// EnableTrace exposes the /debug/pprof/trace endpoint for capturing runtime/execution traces.
+	EnableTrace bool
+	// TraceDuration is the default duration used for a trace capture if the caller does not override it via
+	// the "seconds" query parameter on /debug/pprof/trace.
+	TraceDuration time.Duration
+	// PushEndpoint, if set while EnableProfiling is true, enables continuous profiling: CPU, heap, goroutine,
+	// mutex and block profiles are
+	// captured on PushInterval and POSTed as gzipped pprof to this URL (a pyroscope/parca-compatible ingest
+	// endpoint).
+	PushEndpoint string
+	// PushInterval is the interval at which profiles are captured and pushed. Defaults to 10s if not set.
+	PushInterval time.Duration
+	// PushFormat is the wire format used for pushed profiles. Only PushFormatPprof is currently supported.
+	PushFormat string
 }
 
 // AddFlags adds the needed command line flags to the given FlagSet.
 func (p *ProfilingOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&p.EnableProfiling, "profiling", false, "Enable profiling via web interface host:port/debug/pprof/")
-	fs.BoolVar(&p.EnableContentionProfiling, "contention-profiling", false, "Enable lock contention profiling, if profiling is enabled")
+	fs.IntVar(&p.MutexProfileFraction, "profiling-mutex-fraction", 0, "Fraction of mutex contention events reported in the mutex profile, if profiling is enabled (0 disables mutex profiling)")
+	fs.IntVar(&p.BlockProfileRate, "profiling-block-rate", 0, "Block profile sampling rate in nanoseconds spent blocked per sampled event, if profiling is enabled (0 disables block profiling)")
+	fs.BoolVar(&p.EnableTrace, "profiling-trace", false, "Expose /debug/pprof/trace for runtime execution traces, if profiling is enabled")
+	fs.DurationVar(&p.TraceDuration, "profiling-trace-duration", 1*time.Second, "Default capture duration for /debug/pprof/trace if the caller does not set the 'seconds' query parameter")
+	fs.StringVar(&p.PushEndpoint, "profiling-push-endpoint", "", "Enable continuous profiling by pushing CPU, heap, goroutine, mutex and block profiles to this pyroscope/parca-compatible ingest URL, if profiling is enabled")
+	fs.DurationVar(&p.PushInterval, "profiling-push-interval", 10*time.Second, "Interval at which profiles are captured and pushed, if --profiling-push-endpoint is set")
+	fs.StringVar(&p.PushFormat, "profiling-push-format", PushFormatPprof, "Wire format used for pushed profiles")
+}
+
+// Run applies the profiling options (mutex/block profiling rates) and, if configured, starts the continuous
+// profiling pusher. If EnableProfiling is false it returns nil at once, and it returns an error at once for an
+// unsupported PushFormat; otherwise it blocks until ctx is done, so callers should invoke it in its own
+// goroutine. It is
+// meant to be invoked identically by every main package that embeds ProfilingOptions (controller-manager,
+// gardenlet, ...) so that wiring continuous profiling is uniform across components.
+func (p *ProfilingOptions) Run(ctx context.Context) error {
+	if !p.EnableProfiling {
+		return nil
+	}
+
+	runtime.SetMutexProfileFraction(p.MutexProfileFraction)
+	runtime.SetBlockProfileRate(p.BlockProfileRate)
+
+	if p.PushEndpoint == "" {
+		<-ctx.Done()
+		return nil
+	}
+
+	if p.PushFormat != PushFormatPprof {
+		return fmt.Errorf("unsupported profiling push format %q", p.PushFormat)
+	}
+
+	pusher := &profilePusher{
+		endpoint: p.PushEndpoint,
+		interval: p.PushInterval,
+		labels:   processLabels(),
+		client:   http.DefaultClient,
+	}
+	if pusher.interval <= 0 {
+		pusher.interval = 10 * time.Second
+	}
+
+	return pusher.Run(ctx)
+}
+
+// processLabels derives the labels attached to every pushed profile from the process name and the pod
+// identity exposed via the downward API.
+func processLabels() map[string]string {
+	labels := map[string]string{
+		"process": os.Args[0],
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		labels["hostname"] = hostname
+	}
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		labels["namespace"] = namespace
+	}
+	if name := os.Getenv("POD_NAME"); name != "" {
+		labels["pod"] = name
+	}
+	return labels
+}
+
+// profilePusher periodically captures CPU, heap, goroutine, mutex and block profiles and POSTs them as
+// gzipped pprof to endpoint.
+type profilePusher struct {
+	endpoint string
+	interval time.Duration
+	labels   map[string]string
+	client   *http.Client
+}
+
+func (p *profilePusher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	backoff := p.interval
+	const maxBackoff = 5 * time.Minute
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := p.captureAndPush(ctx); err != nil {
+				backoff *= 2
+				if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+				ticker.Reset(backoff)
+				continue
+			}
+			if backoff != p.interval {
+				backoff = p.interval
+				ticker.Reset(backoff)
+			}
+		}
+	}
+}
+
+func (p *profilePusher) captureAndPush(ctx context.Context) error {
+	profiles, err := p.capture(ctx)
+	if err != nil {
+		return err
+	}
+
+	for name, data := range profiles {
+		if err := p.push(ctx, name, data); err != nil {
+			return fmt.Errorf("failed pushing %s profile: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *profilePusher) capture(ctx context.Context) (map[string][]byte, error) {
+	profiles := map[string][]byte{}
+
+	cpu, err := captureCPUProfile(ctx, p.interval/10)
+	if err != nil {
+		return nil, fmt.Errorf("failed capturing cpu profile: %w", err)
+	}
+	profiles["cpu"] = cpu
+
+	for _, name := range []string{"heap", "goroutine", "mutex", "block"} {
+		var buf bytes.Buffer
+		profile := pprof.Lookup(name)
+		if profile == nil {
+			continue
+		}
+		if err := profile.WriteTo(&buf, 0); err != nil {
+			return nil, fmt.Errorf("failed capturing %s profile: %w", name, err)
+		}
+		profiles[name] = buf.Bytes()
+	}
+
+	return profiles, nil
+}
+
+func captureCPUProfile(ctx context.Context, duration time.Duration) ([]byte, error) {
+	if duration <= 0 {
+		duration = 100 * time.Millisecond
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(duration):
+	}
+	pprof.StopCPUProfile()
+
+	return buf.Bytes(), nil
+}
+
+func (p *profilePusher) push(ctx context.Context, profileName string, data []byte) error {
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	if _, err := gzipWriter.Write(data); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s?name=%s", p.endpoint, profileName)
+	for key, value := range p.labels {
+		url += fmt.Sprintf("&%s=%s", key, value)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &gzipped)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("push endpoint returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// RegisterHandlers registers the net/http/pprof debug handlers on mux if profiling is enabled. Callers
+// (controller-manager's and gardenlet's server setup) invoke this alongside Run so that --profiling,
+// --profiling-trace and --profiling-trace-duration take effect on the actual debug server instead of being
+// parsed and then ignored.
+func (p *ProfilingOptions) RegisterHandlers(mux *http.ServeMux) {
+	if !p.EnableProfiling {
+		return
+	}
+
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+
+	if p.EnableTrace {
+		mux.HandleFunc("/debug/pprof/trace", p.traceHandler())
+	}
+}
+
+// traceHandler serves /debug/pprof/trace using TraceDuration as the default capture length, mirroring
+// net/http/pprof.Trace but allowing the default duration to be configured via ProfilingOptions rather than
+// hardcoded.
+func (p *ProfilingOptions) traceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		duration := p.TraceDuration
+		if sec, err := strconv.ParseFloat(r.FormValue("seconds"), 64); err == nil && sec > 0 {
+			duration = time.Duration(sec * float64(time.Second))
+		}
+		if duration <= 0 {
+			duration = time.Second
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+
+		if err := trace.Start(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer trace.Stop()
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(duration):
+		}
+	}
 }